@@ -0,0 +1,31 @@
+package dnsserver
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/tailscale"
+)
+
+func init() {
+	// The tailscale directive's setup can't import this package directly (we
+	// already import plugin/tailscale below, for TailscaleServer and Health),
+	// so it calls back through this hook instead to bind the server block
+	// it's parsing to the alias it just registered or reused.
+	tailscale.ConfigHook = func(c *caddy.Controller, alias string) {
+		GetConfig(c).TailscaleInstance = alias
+	}
+}
+
+// tailscaleInstance resolves which Tailscale identity this server's listeners
+// should bind through. It honours the first zone Config that names one
+// explicitly via TailscaleInstance, falling back to the default instance
+// (the first one registered) for servers that never opted into a named one.
+func (s *Server) tailscaleInstance() *tailscale.TailscaleServer {
+	for _, configs := range s.zones {
+		for _, c := range configs {
+			if c.TailscaleInstance != "" {
+				return tailscale.Get(c.TailscaleInstance)
+			}
+		}
+	}
+	return tailscale.Get("")
+}
@@ -0,0 +1,353 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/tailscale"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"tailscale.com/ipn"
+)
+
+// quicNetwork is the pseudo-scheme used for DoQ addresses in the Corefile, e.g.
+// "quic://host:853". There's no shared transport.QUIC constant upstream, so we
+// keep the prefix local to this file.
+const quicNetwork = "quic://"
+
+// tailscaleTLSConfig builds a *tls.Config that fetches its certificate from
+// ts on every handshake, so issuance and renewal both happen transparently
+// without restarting the listener.
+func tailscaleTLSConfig(ts *tailscale.TailscaleServer, hostport string) (*tls.Config, error) {
+	domain, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		domain = hostport
+	}
+
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			certPEM, keyPEM, err := ts.Client.CertPair(hello.Context(), domain)
+			if err != nil {
+				return nil, err
+			}
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+	}, nil
+}
+
+// ListenTLS implements the tls:// transport (DoT): it wraps a Tailscale listener
+// in a crypto/tls.Listener whose certificate is obtained live from tailscaled
+// (LetsEncrypt via Tailscale), so renewals need no restart.
+func (s *Server) ListenTLS() (net.Listener, error) {
+	ts := s.tailscaleInstance()
+	if ts == nil {
+		return nil, fmt.Errorf("server: tailscale plugin not initialized and already trying to listen on %s", s.Addr)
+	}
+
+	host := s.Addr[len(transport.TLS+"://"):]
+	l, err := ts.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := tailscaleTLSConfig(ts, host)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return tls.NewListener(l, cfg), nil
+}
+
+// ListenQUIC opens the raw Tailscale PacketConn for the quic:// transport (DoQ).
+// It deliberately stops at the bare socket - wrapping it in a *quic.Listener
+// happens in serveQUIC, once caddy calls ServePacket, mirroring the
+// Listen/Serve split the plain dns:// and tls:// transports already use.
+func (s *Server) ListenQUIC() (net.PacketConn, error) {
+	ts := s.tailscaleInstance()
+	if ts == nil {
+		return nil, fmt.Errorf("server: tailscale plugin not initialized and already trying to listen on %s", s.Addr)
+	}
+
+	host := s.Addr[len(quicNetwork):]
+	return ts.ListenPacket("udp", host)
+}
+
+// ListenDoH opens a TLS-wrapped Tailscale listener for the https:// transport.
+// Like ListenTLS, it only opens the socket; serveDoHListener runs the actual
+// RFC 8484 http.Server over it once caddy calls Serve.
+func (s *Server) ListenDoH() (net.Listener, error) {
+	ts := s.tailscaleInstance()
+	if ts == nil {
+		return nil, fmt.Errorf("server: tailscale plugin not initialized and already trying to listen on %s", s.Addr)
+	}
+
+	host := s.Addr[len(transport.HTTPS+"://"):]
+	l, err := ts.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := tailscaleTLSConfig(ts, host)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return tls.NewListener(l, cfg), nil
+}
+
+// serveDoHListener runs the RFC 8484 mux over l, an already TLS-wrapped
+// listener from ListenDoH, and - unless the zone is tailnet-only - publishes
+// it through Tailscale Serve/Funnel so it's reachable as
+// https://host.ts.net/dns-query without a separate reverse proxy. It blocks
+// until l is closed, matching the Serve contract.
+func (s *Server) serveDoHListener(l net.Listener) error {
+	host := s.Addr[len(transport.HTTPS+"://"):]
+
+	if s.funnelAllowed() {
+		if ts := s.tailscaleInstance(); ts != nil {
+			if err := publishFunnel(ts, host); err != nil {
+				log.Warningf("doh: %s: could not publish via Tailscale Funnel: %s", s.Addr, err)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dns-query", s.serveDoH)
+	httpSrv := &http.Server{Handler: mux}
+
+	tailscale.Health.SetListener("https", true)
+	defer tailscale.Health.SetListener("https", false)
+
+	err := httpSrv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// serveQUIC wraps p, a raw Tailscale PacketConn from ListenQUIC, in a DoQ
+// listener and accepts connections from it until p is closed, matching the
+// ServePacket contract.
+func (s *Server) serveQUIC(p net.PacketConn) error {
+	ts := s.tailscaleInstance()
+	if ts == nil {
+		return fmt.Errorf("server: tailscale plugin not initialized and already trying to listen on %s", s.Addr)
+	}
+
+	host := s.Addr[len(quicNetwork):]
+	cfg, err := tailscaleTLSConfig(ts, host)
+	if err != nil {
+		return err
+	}
+	cfg.NextProtos = []string{"doq"}
+
+	ql, err := quic.Listen(p, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	tailscale.Health.SetListener("quic", true)
+	defer tailscale.Health.SetListener("quic", false)
+
+	for {
+		conn, err := ql.Accept(context.Background())
+		if err != nil {
+			return err
+		}
+		go s.serveQUICConn(conn)
+	}
+}
+
+// serveQUICConn accepts the DoQ streams opened on conn, one query per stream
+// as RFC 9250 requires.
+func (s *Server) serveQUICConn(conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go s.serveQUICStream(conn, stream)
+	}
+}
+
+func (s *Server) serveQUICStream(conn *quic.Conn, stream *quic.Stream) {
+	defer stream.Close()
+
+	buf, err := io.ReadAll(stream)
+	if err != nil {
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		return
+	}
+
+	rw := &quicResponseWriter{conn: conn, stream: stream}
+	ctx := context.WithValue(context.Background(), Key{}, s)
+	ctx = context.WithValue(ctx, LoopKey{}, 0)
+	s.ServeDNS(ctx, rw, req)
+}
+
+// quicResponseWriter adapts a DoQ stream to dns.ResponseWriter so ServeDNS can
+// be reused verbatim for DoQ.
+type quicResponseWriter struct {
+	conn   *quic.Conn
+	stream *quic.Stream
+}
+
+func (q *quicResponseWriter) LocalAddr() net.Addr  { return q.conn.LocalAddr() }
+func (q *quicResponseWriter) RemoteAddr() net.Addr { return q.conn.RemoteAddr() }
+func (q *quicResponseWriter) Close() error         { return q.stream.Close() }
+func (q *quicResponseWriter) TsigStatus() error    { return nil }
+func (q *quicResponseWriter) TsigTimersOnly(bool)  {}
+func (q *quicResponseWriter) Hijack()              {}
+
+func (q *quicResponseWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = q.Write(buf)
+	return err
+}
+
+func (q *quicResponseWriter) Write(buf []byte) (int, error) {
+	n, err := q.stream.Write(buf)
+	if err != nil {
+		return n, err
+	}
+	return n, q.stream.Close()
+}
+
+// funnelAllowed reports whether any zone bound to this server opted into Funnel
+// (public internet) exposure via the Corefile "funnel" directive. Absent that,
+// the https:// endpoint stays reachable only from inside the tailnet.
+func (s *Server) funnelAllowed() bool {
+	for _, configs := range s.zones {
+		for _, c := range configs {
+			if c.AllowFunnel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishFunnel asks tailscaled to advertise host over Tailscale Serve/Funnel so
+// the DoH endpoint is reachable at https://<hostname>.ts.net/dns-query.
+func publishFunnel(ts *tailscale.TailscaleServer, host string) error {
+	cfg, err := funnelServeConfig(host)
+	if err != nil {
+		return err
+	}
+	return ts.Client.SetServeConfig(context.Background(), cfg)
+}
+
+// funnelServeConfig builds the ServeConfig that publishes host over Funnel,
+// registering the TCP handler on host's actual port rather than assuming 443.
+func funnelServeConfig(host string) (*ipn.ServeConfig, error) {
+	_, portStr, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, fmt.Errorf("funnelServeConfig: %s: %w", host, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("funnelServeConfig: %s: invalid port %q: %w", host, portStr, err)
+	}
+
+	return &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			uint16(port): {HTTPS: true},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{
+			ipn.HostPort(host): true,
+		},
+	}, nil
+}
+
+// serveDoH implements the GET and POST forms of RFC 8484 and feeds the decoded
+// dns.Msg into the same zone/plugin-chain dispatch regular queries use.
+func (s *Server) serveDoH(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unsupported content-type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "malformed dns message", http.StatusBadRequest)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		http.Error(w, "malformed dns message", http.StatusBadRequest)
+		return
+	}
+
+	rw := &dohResponseWriter{w: w, r: r}
+	ctx := context.WithValue(context.Background(), Key{}, s)
+	ctx = context.WithValue(ctx, LoopKey{}, 0)
+	s.ServeDNS(ctx, rw, req)
+}
+
+// dohResponseWriter adapts the http request/response pair to dns.ResponseWriter
+// so ServeDNS can be reused verbatim for DoH.
+type dohResponseWriter struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func (d *dohResponseWriter) LocalAddr() net.Addr  { return dohAddr(d.r.Host) }
+func (d *dohResponseWriter) RemoteAddr() net.Addr { return dohAddr(d.r.RemoteAddr) }
+func (d *dohResponseWriter) Close() error         { return nil }
+func (d *dohResponseWriter) TsigStatus() error    { return nil }
+func (d *dohResponseWriter) TsigTimersOnly(bool)  {}
+func (d *dohResponseWriter) Hijack()              {}
+
+func (d *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = d.Write(buf)
+	return err
+}
+
+func (d *dohResponseWriter) Write(buf []byte) (int, error) {
+	d.w.Header().Set("Content-Type", "application/dns-message")
+	d.w.WriteHeader(http.StatusOK)
+	return d.w.Write(buf)
+}
+
+// dohAddr wraps an address string reported by net/http, which doesn't hand us a
+// typed net.Addr, into one that satisfies net.Addr for dns.ResponseWriter.
+type dohAddr string
+
+func (a dohAddr) Network() string { return "tcp" }
+func (a dohAddr) String() string  { return string(a) }
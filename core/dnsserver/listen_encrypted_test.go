@@ -0,0 +1,36 @@
+package dnsserver
+
+import "testing"
+
+func TestFunnelServeConfigUsesActualPort(t *testing.T) {
+	cfg, err := funnelServeConfig("gateway.ts.net:8443")
+	if err != nil {
+		t.Fatalf("funnelServeConfig: %v", err)
+	}
+
+	if _, ok := cfg.TCP[8443]; !ok {
+		t.Errorf("TCP map = %v, want an entry for port 8443", cfg.TCP)
+	}
+	if _, ok := cfg.TCP[443]; ok {
+		t.Errorf("TCP map = %v, want no entry for the default port 443", cfg.TCP)
+	}
+	if !cfg.AllowFunnel["gateway.ts.net:8443"] {
+		t.Errorf("AllowFunnel = %v, want gateway.ts.net:8443 allowed", cfg.AllowFunnel)
+	}
+}
+
+func TestFunnelServeConfigDefaultPort(t *testing.T) {
+	cfg, err := funnelServeConfig("gateway.ts.net:443")
+	if err != nil {
+		t.Fatalf("funnelServeConfig: %v", err)
+	}
+	if _, ok := cfg.TCP[443]; !ok {
+		t.Errorf("TCP map = %v, want an entry for port 443", cfg.TCP)
+	}
+}
+
+func TestFunnelServeConfigRejectsMissingPort(t *testing.T) {
+	if _, err := funnelServeConfig("gateway.ts.net"); err == nil {
+		t.Error("funnelServeConfig with no port: want error, got nil")
+	}
+}
@@ -0,0 +1,144 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/tailscale"
+	"github.com/coredns/coredns/request"
+)
+
+// peerCacheTTL bounds how long a WhoIs answer is trusted for a given source IP before
+// we ask tailscaled again. Node identities don't change quickly enough to warrant a
+// lookup on every query, but we don't want a stale answer to outlive a key rotation
+// or ACL change for long.
+const peerCacheTTL = 30 * time.Second
+
+// Peer describes the Tailscale identity of a query's source address, as resolved by
+// tailscale.Tailscale.Client.WhoIs.
+type Peer struct {
+	Node string
+	User string
+	Tags []string
+	Caps []string
+}
+
+// HasTag reports whether the peer's node carries the given ACL tag (e.g. "tag:admin").
+func (p *Peer) HasTag(tag string) bool {
+	if p == nil {
+		return false
+	}
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCap reports whether the peer was granted the given ACL capability (e.g. "cap:coredns-view:internal").
+func (p *Peer) HasCap(cap string) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Caps {
+		if c == cap {
+			return true
+		}
+	}
+	return false
+}
+
+type peerCacheEntry struct {
+	peer    *Peer
+	expires time.Time
+}
+
+// peerCacheKey partitions the cache by Tailscale instance as well as source IP,
+// so two tailnet identities serving the same Corefile can't leak WhoIs answers
+// resolved against the wrong instance into each other's entries.
+type peerCacheKey struct {
+	ts   *tailscale.TailscaleServer
+	host string
+}
+
+var (
+	peerCacheMu sync.Mutex
+	peerCache   = map[peerCacheKey]peerCacheEntry{}
+)
+
+// lookupPeer resolves the Tailscale identity behind remoteAddr against ts, caching
+// the result per (ts, source IP) for peerCacheTTL. It returns nil when ts is nil,
+// or when remoteAddr isn't a tailnet peer of ts.
+func lookupPeer(ctx context.Context, ts *tailscale.TailscaleServer, remoteAddr string) *Peer {
+	if ts == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	key := peerCacheKey{ts: ts, host: host}
+
+	peerCacheMu.Lock()
+	if e, ok := peerCache[key]; ok && time.Now().Before(e.expires) {
+		peerCacheMu.Unlock()
+		return e.peer
+	}
+	peerCacheMu.Unlock()
+
+	who, err := ts.Client.WhoIs(ctx, remoteAddr)
+	if err != nil || who == nil {
+		// Not a tailnet peer, or tailscaled couldn't answer - don't cache negative
+		// results, a retry a moment later (e.g. right after a peer joins) is cheap.
+		return nil
+	}
+
+	p := &Peer{}
+	if who.Node != nil {
+		p.Node = who.Node.Name
+		p.Tags = who.Node.Tags
+	}
+	if who.UserProfile != nil {
+		p.User = who.UserProfile.LoginName
+	}
+	for cap := range who.CapMap {
+		p.Caps = append(p.Caps, string(cap))
+	}
+
+	peerCacheMu.Lock()
+	peerCache[key] = peerCacheEntry{peer: p, expires: time.Now().Add(peerCacheTTL)}
+	peerCacheMu.Unlock()
+
+	return p
+}
+
+// NewUserFilterFunc returns a FilterFunc that only passes for queries whose source
+// peer's tailnet login matches user.
+func NewUserFilterFunc(user string) FilterFunc {
+	return func(ctx context.Context, _ *request.Request) bool {
+		p, _ := ctx.Value(PeerKey{}).(*Peer)
+		return p != nil && p.User == user
+	}
+}
+
+// NewTagFilterFunc returns a FilterFunc that only passes for queries whose source
+// peer's node carries the given ACL tag.
+func NewTagFilterFunc(tag string) FilterFunc {
+	return func(ctx context.Context, _ *request.Request) bool {
+		p, _ := ctx.Value(PeerKey{}).(*Peer)
+		return p.HasTag(tag)
+	}
+}
+
+// NewCapFilterFunc returns a FilterFunc that only passes for queries whose source
+// peer was granted the given ACL capability.
+func NewCapFilterFunc(cap string) FilterFunc {
+	return func(ctx context.Context, _ *request.Request) bool {
+		p, _ := ctx.Value(PeerKey{}).(*Peer)
+		return p.HasCap(cap)
+	}
+}
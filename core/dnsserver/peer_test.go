@@ -0,0 +1,84 @@
+package dnsserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/request"
+)
+
+func ctxWithPeer(p *Peer) context.Context {
+	if p == nil {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), PeerKey{}, p)
+}
+
+func TestNewUserFilterFunc(t *testing.T) {
+	filter := NewUserFilterFunc("alice@example.com")
+
+	cases := []struct {
+		name string
+		peer *Peer
+		want bool
+	}{
+		{"matching user", &Peer{User: "alice@example.com"}, true},
+		{"different user", &Peer{User: "bob@example.com"}, false},
+		{"no peer resolved", nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filter(ctxWithPeer(tc.peer), &request.Request{}); got != tc.want {
+				t.Errorf("filter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewTagFilterFunc(t *testing.T) {
+	filter := NewTagFilterFunc("tag:admin")
+
+	cases := []struct {
+		name string
+		peer *Peer
+		want bool
+	}{
+		{"has tag", &Peer{Tags: []string{"tag:admin", "tag:other"}}, true},
+		{"missing tag", &Peer{Tags: []string{"tag:other"}}, false},
+		{"no peer resolved", nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filter(ctxWithPeer(tc.peer), &request.Request{}); got != tc.want {
+				t.Errorf("filter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewCapFilterFunc(t *testing.T) {
+	filter := NewCapFilterFunc("cap:coredns-view:internal")
+
+	cases := []struct {
+		name string
+		peer *Peer
+		want bool
+	}{
+		{"has cap", &Peer{Caps: []string{"cap:coredns-view:internal"}}, true},
+		{"missing cap", &Peer{Caps: []string{"cap:other"}}, false},
+		{"no peer resolved", nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filter(ctxWithPeer(tc.peer), &request.Request{}); got != tc.want {
+				t.Errorf("filter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLookupPeerNilInstance(t *testing.T) {
+	if p := lookupPeer(context.Background(), nil, "100.64.0.1:12345"); p != nil {
+		t.Errorf("lookupPeer with nil instance = %v, want nil", p)
+	}
+}
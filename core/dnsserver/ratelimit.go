@@ -0,0 +1,131 @@
+package dnsserver
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitShards   = 32
+	rateLimitEntryTTL = 5 * time.Minute
+)
+
+type rateLimitEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSwept time.Time
+}
+
+// rateLimiter is a sharded, lazily-evicted set of per-key token buckets backing
+// one zone's RateLimitQPS/RateLimitBurst Corefile setting.
+type rateLimiter struct {
+	qps    rate.Limit
+	burst  int
+	shards [rateLimitShards]*rateLimitShard
+}
+
+func newRateLimiter(qps float64, burst int) *rateLimiter {
+	rl := &rateLimiter{qps: rate.Limit(qps), burst: burst}
+	for i := range rl.shards {
+		rl.shards[i] = &rateLimitShard{entries: make(map[string]*rateLimitEntry)}
+	}
+	return rl
+}
+
+func (rl *rateLimiter) shardFor(key string) *rateLimitShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return rl.shards[h.Sum32()%rateLimitShards]
+}
+
+// Allow reports whether a query for key may proceed, creating its token bucket
+// lazily on first use. At most once per rateLimitEntryTTL, the call also sweeps
+// buckets in key's shard that have been idle for longer than rateLimitEntryTTL,
+// so the map doesn't grow unbounded as clients come and go, without scanning the
+// shard on every single query.
+func (rl *rateLimiter) Allow(key string) bool {
+	shard := rl.shardFor(key)
+	now := time.Now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if now.Sub(shard.lastSwept) > rateLimitEntryTTL {
+		for k, e := range shard.entries {
+			if now.Sub(e.lastSeen) > rateLimitEntryTTL {
+				delete(shard.entries, k)
+			}
+		}
+		shard.lastSwept = now
+	}
+
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &rateLimitEntry{limiter: rate.NewLimiter(rl.qps, rl.burst)}
+		shard.entries[key] = e
+	}
+	e.lastSeen = now
+
+	return e.limiter.Allow()
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[*Config]*rateLimiter{}
+)
+
+// rateLimiterFor lazily builds and caches the rateLimiter for h.
+func rateLimiterFor(h *Config) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if rl, ok := rateLimiters[h]; ok {
+		return rl
+	}
+
+	burst := h.RateLimitBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	rl := newRateLimiter(h.RateLimitQPS, burst)
+	rateLimiters[h] = rl
+	return rl
+}
+
+// ReleaseRateLimiter drops h's rate limiter, if any. The tsratelimit setup
+// registers this as a caddy shutdown hook so a Corefile reload doesn't leak
+// the previous generation's Config (and its token buckets) forever.
+func ReleaseRateLimiter(h *Config) {
+	rateLimitersMu.Lock()
+	delete(rateLimiters, h)
+	rateLimitersMu.Unlock()
+}
+
+// rateLimitKey derives the identifier a query is rate limited by, per h's
+// RateLimitKey setting ("ip", "tailnet-node" or "tailnet-user"). It falls back
+// to the source IP whenever the configured identity isn't available, e.g. a
+// "tailnet-user" zone queried by a peer WhoIs couldn't resolve.
+func rateLimitKey(ctx context.Context, h *Config, req *request.Request) string {
+	switch h.RateLimitKey {
+	case "tailnet-node":
+		if p, _ := ctx.Value(PeerKey{}).(*Peer); p != nil && p.Node != "" {
+			return "node:" + p.Node
+		}
+	case "tailnet-user":
+		if p, _ := ctx.Value(PeerKey{}).(*Peer); p != nil && p.User != "" {
+			return "user:" + p.User
+		}
+	}
+	return "ip:" + req.IP()
+}
@@ -0,0 +1,104 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/coredns/coredns/request"
+)
+
+func TestRateLimiterAllowsBurstThenBlocks(t *testing.T) {
+	rl := newRateLimiter(1, 2)
+
+	if !rl.Allow("client") {
+		t.Fatal("first request within burst: want allowed")
+	}
+	if !rl.Allow("client") {
+		t.Fatal("second request within burst: want allowed")
+	}
+	if rl.Allow("client") {
+		t.Fatal("third request beyond burst: want blocked")
+	}
+}
+
+func TestRateLimiterKeysAreIndependent(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+
+	if !rl.Allow("a") {
+		t.Fatal("first request for key a: want allowed")
+	}
+	if !rl.Allow("b") {
+		t.Fatal("first request for key b: want allowed, a's bucket must not affect b")
+	}
+	if rl.Allow("a") {
+		t.Fatal("second request for key a beyond burst: want blocked")
+	}
+}
+
+func TestRateLimiterForCachesAndReleases(t *testing.T) {
+	h := &Config{RateLimitQPS: 5, RateLimitBurst: 5}
+
+	rl1 := rateLimiterFor(h)
+	rl2 := rateLimiterFor(h)
+	if rl1 != rl2 {
+		t.Error("rateLimiterFor(h) returned a different limiter on the second call for the same Config")
+	}
+
+	ReleaseRateLimiter(h)
+
+	rl3 := rateLimiterFor(h)
+	if rl3 == rl1 {
+		t.Error("rateLimiterFor(h) after ReleaseRateLimiter returned the stale limiter instead of a fresh one")
+	}
+	ReleaseRateLimiter(h)
+}
+
+func TestRateLimitKey(t *testing.T) {
+	req := &request.Request{Req: new(dns.Msg), W: &testResponseWriter{}}
+
+	cases := []struct {
+		name string
+		key  string
+		peer *Peer
+		want string
+	}{
+		{"ip fallback, no key configured", "", nil, "ip:127.0.0.1"},
+		{"tailnet-node with peer", "tailnet-node", &Peer{Node: "laptop"}, "node:laptop"},
+		{"tailnet-node without peer falls back to ip", "tailnet-node", nil, "ip:127.0.0.1"},
+		{"tailnet-user with peer", "tailnet-user", &Peer{User: "alice@example.com"}, "user:alice@example.com"},
+		{"tailnet-user without peer falls back to ip", "tailnet-user", nil, "ip:127.0.0.1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Config{RateLimitKey: tc.key}
+			ctx := context.Background()
+			if tc.peer != nil {
+				ctx = context.WithValue(ctx, PeerKey{}, tc.peer)
+			}
+			if got := rateLimitKey(ctx, h, req); got != tc.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// testResponseWriter is a minimal dns.ResponseWriter sufficient for
+// request.Request.IP() to resolve an address.
+type testResponseWriter struct{}
+
+func (testResponseWriter) LocalAddr() net.Addr       { return testAddr("127.0.0.1:53") }
+func (testResponseWriter) RemoteAddr() net.Addr      { return testAddr("127.0.0.1:5300") }
+func (testResponseWriter) WriteMsg(*dns.Msg) error   { return nil }
+func (testResponseWriter) Write([]byte) (int, error) { return 0, nil }
+func (testResponseWriter) Close() error              { return nil }
+func (testResponseWriter) TsigStatus() error         { return nil }
+func (testResponseWriter) TsigTimersOnly(bool)       {}
+func (testResponseWriter) Hijack()                   {}
+
+type testAddr string
+
+func (a testAddr) Network() string { return "udp" }
+func (a testAddr) String() string  { return string(a) }
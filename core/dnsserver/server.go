@@ -144,8 +144,14 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 var _ caddy.GracefulServer = &Server{}
 
 // Serve starts the server with an existing listener. It blocks until the server stops.
-// This implements caddy.TCPServer interface.
+// This implements caddy.TCPServer interface. For https:// addresses l is
+// already TLS-wrapped (see ListenDoH) and serveDoHListener runs the RFC 8484
+// mux over it instead of the raw DNS-over-TCP framing below.
 func (s *Server) Serve(l net.Listener) error {
+	if strings.HasPrefix(s.Addr, transport.HTTPS+"://") {
+		return s.serveDoHListener(l)
+	}
+
 	s.m.Lock()
 
 	s.server[tcp] = &dns.Server{Listener: l,
@@ -165,12 +171,21 @@ func (s *Server) Serve(l net.Listener) error {
 
 	s.m.Unlock()
 
+	tailscale.Health.SetListener("tcp", true)
+	defer tailscale.Health.SetListener("tcp", false)
+
 	return s.server[tcp].ActivateAndServe()
 }
 
 // ServePacket starts the server with an existing packetconn. It blocks until the server stops.
-// This implements caddy.UDPServer interface.
+// This implements caddy.UDPServer interface. For quic:// addresses p is the
+// raw PacketConn from ListenQUIC and serveQUIC wraps it in a DoQ listener
+// instead of the plain DNS-over-UDP framing below.
 func (s *Server) ServePacket(p net.PacketConn) error {
+	if strings.HasPrefix(s.Addr, quicNetwork) {
+		return s.serveQUIC(p)
+	}
+
 	s.m.Lock()
 	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
@@ -179,16 +194,30 @@ func (s *Server) ServePacket(p net.PacketConn) error {
 	}), TsigSecret: s.tsigSecret}
 	s.m.Unlock()
 
+	tailscale.Health.SetListener("udp", true)
+	defer tailscale.Health.SetListener("udp", false)
+
 	return s.server[udp].ActivateAndServe()
 }
 
-// Listen implements caddy.TCPServer interface.
+// Listen implements caddy.TCPServer interface. The transport is chosen by the
+// scheme prefix on s.Addr: dns:// opens a plain Tailscale listener, tls://
+// and https:// delegate to ListenTLS/ListenDoH so DoT and DoH share the same
+// Listen/Serve split as plain DNS.
 func (s *Server) Listen() (net.Listener, error) {
-	if tailscale.Tailscale == nil {
+	switch {
+	case strings.HasPrefix(s.Addr, transport.TLS+"://"):
+		return s.ListenTLS()
+	case strings.HasPrefix(s.Addr, transport.HTTPS+"://"):
+		return s.ListenDoH()
+	}
+
+	ts := s.tailscaleInstance()
+	if ts == nil {
 		return nil, fmt.Errorf("server: tailscale plugin not initialized and already trying to listen on %s", s.Addr)
 	}
 
-	l, err := tailscale.Tailscale.Listen("tcp", s.Addr[len(transport.DNS+"://"):])
+	l, err := ts.Listen("tcp", s.Addr[len(transport.DNS+"://"):])
 	if err != nil {
 		return nil, err
 	}
@@ -200,13 +229,19 @@ func (s *Server) WrapListener(ln net.Listener) net.Listener {
 	return ln
 }
 
-// ListenPacket implements caddy.UDPServer interface.
+// ListenPacket implements caddy.UDPServer interface. quic:// delegates to
+// ListenQUIC for the same reason Listen delegates to ListenTLS/ListenDoH.
 func (s *Server) ListenPacket() (net.PacketConn, error) {
-	if tailscale.Tailscale == nil {
+	if strings.HasPrefix(s.Addr, quicNetwork) {
+		return s.ListenQUIC()
+	}
+
+	ts := s.tailscaleInstance()
+	if ts == nil {
 		return nil, fmt.Errorf("server: tailscale plugin not initialized")
 	}
 
-	p, err := tailscale.Tailscale.ListenPacket("udp", s.Addr[len(transport.DNS+"://"):])
+	p, err := ts.ListenPacket("udp", s.Addr[len(transport.DNS+"://"):])
 	if err != nil {
 		return nil, err
 	}
@@ -286,6 +321,15 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		return
 	}
 
+	if r.Opcode != dns.OpcodeQuery && r.Opcode != dns.OpcodeUpdate {
+		// Anything but a plain query or an RFC 2136 update is rejected right here.
+		// Update itself is let through to the zone lookup below, which answers it
+		// with NOTIMP per zone unless that zone's Config has TSUpdateEnabled (the tsupdate
+		// plugin is in its chain).
+		errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+		return
+	}
+
 	if m, err := edns.Version(r); err != nil { // Wrong EDNS version, return at once.
 		w.WriteMsg(m)
 		return
@@ -294,6 +338,12 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	// Wrap the response writer in a ScrubWriter so we automatically make the reply fit in the client's buffer.
 	w = request.NewScrubWriter(r, w)
 
+	// Resolve the caller's Tailscale identity (if any) once per request, so FilterFuncs and
+	// the require-tailnet check further down can key off of it without each doing their own WhoIs.
+	if peer := lookupPeer(ctx, s.tailscaleInstance(), w.RemoteAddr().String()); peer != nil {
+		ctx = context.WithValue(ctx, PeerKey{}, peer)
+	}
+
 	q := strings.ToLower(r.Question[0].Name)
 	var (
 		off       int
@@ -316,6 +366,33 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 				// If all filter funcs pass, use this config.
 				if passAllFilterFuncs(ctx, h.FilterFuncs, &request.Request{Req: r, W: w}) {
+					if r.Opcode == dns.OpcodeUpdate && !h.TSUpdateEnabled {
+						// This zone has no tsupdate in its chain - the plugin chain below
+						// would otherwise see an Update it was never built to handle.
+						errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+						return
+					}
+
+					if h.RefuseANY && r.Question[0].Qtype == dns.TypeANY {
+						errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+						return
+					}
+
+					if h.RateLimitQPS > 0 {
+						key := rateLimitKey(ctx, h, &request.Request{Req: r, W: w})
+						if !rateLimiterFor(h).Allow(key) {
+							vars.RateLimited.WithLabelValues(h.RateLimitKey).Inc()
+							errorAndMetricsFunc(s.Addr, w, r, dns.RcodeRefused)
+							return
+						}
+					}
+
+					if h.RequireTailnet && ctx.Value(PeerKey{}) == nil {
+						// Corefile asked us to refuse anything that did not resolve to a tailnet identity.
+						errorAndMetricsFunc(s.Addr, w, r, dns.RcodeRefused)
+						return
+					}
+
 					if h.ViewName != "" {
 						// if there was a view defined for this Config, set the view name in the context
 						ctx = context.WithValue(ctx, ViewKey{}, h.ViewName)
@@ -324,6 +401,8 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 						rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
 						if !plugin.ClientWrite(rcode) {
 							errorFunc(s.Addr, w, r, rcode)
+						} else {
+							tailscale.Health.RecordZoneServe(h.Zone)
 						}
 						return
 					}
@@ -347,6 +426,8 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		rcode, _ := dshandler.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
 			errorFunc(s.Addr, w, r, rcode)
+		} else {
+			tailscale.Health.RecordZoneServe(dshandler.Zone)
 		}
 		return
 	}
@@ -365,6 +446,30 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 			// If all filter funcs pass, use this config.
 			if passAllFilterFuncs(ctx, h.FilterFuncs, &request.Request{Req: r, W: w}) {
+				if r.Opcode == dns.OpcodeUpdate && !h.TSUpdateEnabled {
+					errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+					return
+				}
+
+				if h.RefuseANY && r.Question[0].Qtype == dns.TypeANY {
+					errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+					return
+				}
+
+				if h.RateLimitQPS > 0 {
+					key := rateLimitKey(ctx, h, &request.Request{Req: r, W: w})
+					if !rateLimiterFor(h).Allow(key) {
+						vars.RateLimited.WithLabelValues(h.RateLimitKey).Inc()
+						errorAndMetricsFunc(s.Addr, w, r, dns.RcodeRefused)
+						return
+					}
+				}
+
+				if h.RequireTailnet && ctx.Value(PeerKey{}) == nil {
+					errorAndMetricsFunc(s.Addr, w, r, dns.RcodeRefused)
+					return
+				}
+
 				if h.ViewName != "" {
 					// if there was a view defined for this Config, set the view name in the context
 					ctx = context.WithValue(ctx, ViewKey{}, h.ViewName)
@@ -372,6 +477,8 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 				rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
 				if !plugin.ClientWrite(rcode) {
 					errorFunc(s.Addr, w, r, rcode)
+				} else {
+					tailscale.Health.RecordZoneServe(h.Zone)
 				}
 				return
 			}
@@ -453,6 +560,10 @@ type (
 
 	// ViewKey is the context key for the current view, if defined
 	ViewKey struct{}
+
+	// PeerKey is the context key for the requesting Peer, resolved via Tailscale WhoIs.
+	// Only present once a WhoIs lookup for the request's source address has succeeded.
+	PeerKey struct{}
 )
 
 // EnableChaos is a map with plugin names for which we should open CH class queries as we block these by default.
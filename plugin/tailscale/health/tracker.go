@@ -0,0 +1,136 @@
+// Package health tracks the operational state of the Tailscale-backed listeners
+// and zones in this module, so it can be surfaced to operators (e.g. by the
+// metrics-ts plugin) without having to scrape tailscaled directly.
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker records the signals operators care about when deciding whether this
+// resolver is healthy: the tsnet backend's state, whether each listener is up,
+// the last time we could reach tailscaled at all, and the last time each zone
+// actually answered a query.
+type Tracker struct {
+	mu sync.Mutex
+
+	backendState      string
+	backendStateSince time.Time
+
+	listeners map[string]bool
+
+	lastStatusOK  time.Time
+	lastStatusErr string
+
+	zoneLastServe map[string]time.Time
+}
+
+// NewTracker returns an empty Tracker ready to record state.
+func NewTracker() *Tracker {
+	return &Tracker{
+		listeners:     make(map[string]bool),
+		zoneLastServe: make(map[string]time.Time),
+	}
+}
+
+// SetBackendState records a tsnet BackendState transition (e.g. "NeedsLogin",
+// "Starting", "Running").
+func (t *Tracker) SetBackendState(state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.backendState == state {
+		return
+	}
+	t.backendState = state
+	t.backendStateSince = time.Now()
+}
+
+// SetListener records whether the named listener (e.g. "tcp", "udp") is
+// currently accepting connections.
+func (t *Tracker) SetListener(name string, up bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners[name] = up
+}
+
+// RecordStatus records the outcome of a Client.Status call, so we know how
+// stale our view of tailscaled is.
+func (t *Tracker) RecordStatus(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.lastStatusErr = err.Error()
+		return
+	}
+	t.lastStatusOK = time.Now()
+	t.lastStatusErr = ""
+}
+
+// RecordZoneServe marks zone as having just answered a query successfully.
+func (t *Tracker) RecordZoneServe(zone string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.zoneLastServe[zone] = time.Now()
+}
+
+// Healthy reports whether the tracker considers the resolver up: the tsnet
+// backend must be Running and every tracked listener must be up.
+func (t *Tracker) Healthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.healthyLocked()
+}
+
+// healthyLocked is Healthy's logic without acquiring t.mu, for callers (like
+// Snapshot) that already hold it.
+func (t *Tracker) healthyLocked() bool {
+	if t.backendState != "Running" {
+		return false
+	}
+	for _, up := range t.listeners {
+		if !up {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot is the JSON-serializable view of a Tracker exposed at /healthz.
+type Snapshot struct {
+	Healthy           bool                 `json:"healthy"`
+	BackendState      string               `json:"backendState"`
+	BackendStateSince time.Time            `json:"backendStateSince"`
+	Listeners         map[string]bool      `json:"listeners"`
+	LastStatusOK      time.Time            `json:"lastStatusOK"`
+	LastStatusError   string               `json:"lastStatusError,omitempty"`
+	Zones             map[string]time.Time `json:"zones"`
+}
+
+// Snapshot returns a point-in-time copy of the tracker's state.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	listeners := make(map[string]bool, len(t.listeners))
+	for k, v := range t.listeners {
+		listeners[k] = v
+	}
+	zones := make(map[string]time.Time, len(t.zoneLastServe))
+	for k, v := range t.zoneLastServe {
+		zones[k] = v
+	}
+
+	return Snapshot{
+		Healthy:           t.healthyLocked(),
+		BackendState:      t.backendState,
+		BackendStateSince: t.backendStateSince,
+		Listeners:         listeners,
+		LastStatusOK:      t.lastStatusOK,
+		LastStatusError:   t.lastStatusErr,
+		Zones:             zones,
+	}
+}
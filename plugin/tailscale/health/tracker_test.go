@@ -0,0 +1,47 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSnapshotDoesNotDeadlock guards against Snapshot calling a locking method
+// (like Healthy) while already holding t.mu.
+func TestSnapshotDoesNotDeadlock(t *testing.T) {
+	tr := NewTracker()
+	tr.SetBackendState("Running")
+	tr.SetListener("tcp", true)
+
+	done := make(chan Snapshot, 1)
+	go func() { done <- tr.Snapshot() }()
+
+	select {
+	case snap := <-done:
+		if !snap.Healthy {
+			t.Errorf("Snapshot().Healthy = false, want true")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Snapshot() deadlocked")
+	}
+}
+
+func TestSnapshotHealthy(t *testing.T) {
+	tr := NewTracker()
+
+	if snap := tr.Snapshot(); snap.Healthy {
+		t.Errorf("fresh tracker: Healthy = true, want false (no backend state yet)")
+	}
+
+	tr.SetBackendState("Running")
+	tr.SetListener("tcp", true)
+	tr.SetListener("udp", true)
+
+	if snap := tr.Snapshot(); !snap.Healthy {
+		t.Errorf("Running backend with all listeners up: Healthy = false, want true")
+	}
+
+	tr.SetListener("udp", false)
+	if snap := tr.Snapshot(); snap.Healthy {
+		t.Errorf("one listener down: Healthy = true, want false")
+	}
+}
@@ -6,50 +6,105 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/tailscale/health"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/tsnet"
 )
 
 var log = clog.NewWithPlugin("tailscale")
 
+// Tailscale is the default identity: the first one registered by any
+// `tailscale <hostname> [alias]` stanza. Kept for callers that only ever
+// deal with a single tailnet identity; multi-identity setups should resolve
+// their instance by alias through Get instead.
 var Tailscale *TailscaleServer = nil
 
+// Health tracks the state of the tsnet backend and the listeners/zones built on
+// top of it, for consumption by the metrics-ts plugin.
+var Health = health.NewTracker()
+
+var (
+	instancesMu  sync.Mutex
+	instances    = map[string]*TailscaleServer{}
+	defaultAlias string
+)
+
+// ConfigHook, when set, lets setup bind the server block it's parsing to the
+// alias it just registered. core/dnsserver sets this in an init() of its own,
+// since plugin/tailscale can't import core/dnsserver directly without an
+// import cycle (core/dnsserver already imports plugin/tailscale for
+// TailscaleServer and Health).
+var ConfigHook func(c *caddy.Controller, alias string)
+
+// Get returns the tailnet identity registered under alias. An empty alias
+// resolves to the default instance (the first one registered).
+func Get(alias string) *TailscaleServer {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+
+	if alias == "" {
+		alias = defaultAlias
+	}
+	return instances[alias]
+}
+
 func init() { plugin.Register("tailscale", setup) }
 
 func setup(c *caddy.Controller) error {
-	var hostname string
+	var hostname, alias string
 	if c.Next() {
-		if !c.Args(&hostname) {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+			hostname = args[0]
+		case 2:
+			hostname, alias = args[0], args[1]
+		default:
 			return c.ArgErr()
 		}
 	} else {
 		return fmt.Errorf("missing hostname")
 	}
-
-	err := start(hostname)
-	if err != nil {
-		return err
+	if alias == "" {
+		alias = hostname
 	}
 
-	c.OnStartup(func() error {
-		return nil
-	})
+	instancesMu.Lock()
+	ts, alreadyRunning := instances[alias]
+	instancesMu.Unlock()
 
-	c.OnShutdown(func() error {
-		if Tailscale.Server != nil {
-			err := Tailscale.Server.Close()
-			if err != nil {
-				return err
-			}
+	if !alreadyRunning {
+		var err error
+		ts, err = start(hostname, alias)
+		if err != nil {
+			return err
 		}
 
-		return nil
-	})
+		instancesMu.Lock()
+		instances[alias] = ts
+		if defaultAlias == "" {
+			defaultAlias = alias
+			Tailscale = ts
+		}
+		instancesMu.Unlock()
+
+		c.OnShutdown(func() error {
+			if ts.Server != nil {
+				return ts.Server.Close()
+			}
+			return nil
+		})
+	}
+
+	if ConfigHook != nil {
+		ConfigHook(c, alias)
+	}
 
 	return nil
 }
@@ -60,57 +115,61 @@ func systemTailscaleRunning() bool {
 	return err == nil
 }
 
-func start(hostname string) error {
-	Tailscale = &TailscaleServer{}
+// start brings up the tailnet identity named by hostname for alias (setup then
+// registers it), isolating its tsnet state directory from any other instance so that
+// running several stanzas in one process doesn't clobber state between them.
+func start(hostname, alias string) (*TailscaleServer, error) {
+	ts := &TailscaleServer{}
 
 	if systemTailscaleRunning() {
-		Tailscale.Server = nil
-		Tailscale.Client = &tailscale.LocalClient{}
+		ts.Server = nil
+		ts.Client = &tailscale.LocalClient{}
 	} else {
-		// Create a unique config directory for this instance based on the hostname
+		// Create a unique config directory per instance, keyed by alias so two
+		// stanzas sharing a hostname still get isolated state.
 		globalConfigDir, err := os.UserConfigDir()
 		if err != nil {
-			return fmt.Errorf("failed to obtain user config dir: %w", err)
+			return nil, fmt.Errorf("failed to obtain user config dir: %w", err)
 		}
-		configDir := filepath.Join(globalConfigDir, "coredns-tailscale", hostname)
+		configDir := filepath.Join(globalConfigDir, "coredns-tailscale", alias)
 		err = os.MkdirAll(configDir, fs.FileMode(0700))
 		if err != nil {
-			return fmt.Errorf("failed to create config directory: %w", err)
+			return nil, fmt.Errorf("failed to create config directory: %w", err)
 		}
 
-		// Start the local tailscale instance
-		Tailscale = &TailscaleServer{}
-		Tailscale.Server = &tsnet.Server{
+		ts.Server = &tsnet.Server{
 			Dir:          configDir,
 			Hostname:     hostname,
 			UserLogf:     log.Infof,
 			Logf:         log.Debugf,
 			RunWebClient: true,
 		}
-		err = Tailscale.Server.Start()
+		err = ts.Server.Start()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		Tailscale.Client, err = Tailscale.Server.LocalClient()
+		ts.Client, err = ts.Server.LocalClient()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// Wait for tailscale to properly initialize
 	for {
-		status, err := Tailscale.Client.Status(context.Background())
+		status, err := ts.Client.Status(context.Background())
+		Health.RecordStatus(err)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		Health.SetBackendState(status.BackendState)
 		if status.BackendState == "Running" {
 			break
 		} else {
-			log.Info("waiting for tailscale")
+			log.Infof("waiting for tailscale (%s)", alias)
 			time.Sleep(1 * time.Second)
 		}
 	}
 
-	return nil
+	return ts, nil
 }
@@ -0,0 +1,47 @@
+package tailscale
+
+import "testing"
+
+// resetInstances clears package-level registry state between tests, since
+// instances/defaultAlias/Tailscale are shared globals that setup would
+// normally populate via the Corefile.
+func resetInstances(t *testing.T) {
+	t.Helper()
+	instancesMu.Lock()
+	instances = map[string]*TailscaleServer{}
+	defaultAlias = ""
+	Tailscale = nil
+	instancesMu.Unlock()
+}
+
+func TestGetDefaultAlias(t *testing.T) {
+	resetInstances(t)
+
+	first := &TailscaleServer{}
+	second := &TailscaleServer{}
+
+	instancesMu.Lock()
+	instances["home"] = first
+	defaultAlias = "home"
+	Tailscale = first
+	instances["work"] = second
+	instancesMu.Unlock()
+
+	if got := Get(""); got != first {
+		t.Errorf("Get(\"\") = %p, want the first-registered instance %p", got, first)
+	}
+	if got := Get("work"); got != second {
+		t.Errorf("Get(\"work\") = %p, want %p", got, second)
+	}
+	if got := Get("nonexistent"); got != nil {
+		t.Errorf("Get(\"nonexistent\") = %v, want nil", got)
+	}
+}
+
+func TestGetUnregisteredReturnsNil(t *testing.T) {
+	resetInstances(t)
+
+	if got := Get("anything"); got != nil {
+		t.Errorf("Get on empty registry = %v, want nil", got)
+	}
+}
@@ -15,13 +15,14 @@ func init() { plugin.Register("tsbind", setup) }
 func setup(c *caddy.Controller) error {
 	config := dnsserver.GetConfig(c)
 
-	if tailscale.Tailscale == nil {
-		return fmt.Errorf("tsbind: tailscale not initialized")
+	ts := tailscale.Get(config.TailscaleInstance)
+	if ts == nil {
+		return fmt.Errorf("tsbind: tailscale instance %q not initialized", config.TailscaleInstance)
 	}
 
 	// collect all address from tailscale
 	all := []string{}
-	status, err := tailscale.Tailscale.Client.StatusWithoutPeers(context.Background())
+	status, err := ts.Client.StatusWithoutPeers(context.Background())
 	if err != nil {
 		return fmt.Errorf("tailscale status: %w", err)
 	}
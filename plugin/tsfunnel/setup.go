@@ -0,0 +1,24 @@
+// Package tsfunnel implements the funnel directive, which opts a zone's https://
+// listener into Tailscale Funnel (public internet) exposure. Without it, DoH
+// endpoints stay reachable only from inside the tailnet.
+package tsfunnel
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("funnel", setup) }
+
+func setup(c *caddy.Controller) error {
+	c.Next() // directive name, no arguments
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.AllowFunnel = true
+
+	return nil
+}
@@ -0,0 +1,77 @@
+// Package tsmetrics implements the metrics-ts plugin, which exposes Prometheus
+// metrics and a JSON health check on a Tailscale-only listener - never on the
+// host's LAN interfaces - so operators can scrape and probe the resolver from
+// within their tailnet without exposing it any more broadly.
+package tsmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/tailscale"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var log = clog.NewWithPlugin("metrics-ts")
+
+const defaultAddr = ":9001"
+
+func init() { plugin.Register("metrics-ts", setup) }
+
+func setup(c *caddy.Controller) error {
+	addr := defaultAddr
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			addr = args[0]
+		default:
+			return c.ArgErr()
+		}
+	}
+
+	if tailscale.Tailscale == nil {
+		return fmt.Errorf("metrics-ts: tailscale plugin not initialized")
+	}
+
+	c.OnStartup(func() error {
+		l, err := tailscale.Tailscale.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("metrics-ts: %w", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.HandleFunc("/healthz", healthzHandler)
+
+		srv := &http.Server{Handler: mux}
+		go func() {
+			if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+				log.Errorf("metrics-ts: %s", err)
+			}
+		}()
+
+		c.OnShutdown(func() error {
+			return srv.Close()
+		})
+
+		return nil
+	})
+
+	return nil
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	snap := tailscale.Health.Snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !snap.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(snap)
+}
@@ -1,6 +1,8 @@
 package tsproxy
 
 import (
+	"fmt"
+
 	"github.com/coredns/coredns/plugin/tailscale"
 )
 
@@ -19,25 +21,33 @@ type tsproxy struct {
 	proxies []closeable
 }
 
-func (proxy *tsproxy) start(channels []channel) {
+// start brings up the given channels against the named Tailscale instance
+// (empty selects the default one).
+func (proxy *tsproxy) start(channels []channel, instance string) error {
 	log.Infof("starting tsproxy on %d channels", len(channels))
 
+	ts := tailscale.Get(instance)
+	if ts == nil {
+		return fmt.Errorf("tsproxy: tailscale instance %q not initialized", instance)
+	}
+
 	// run the proxies
 	for _, channel := range channels {
 		var p closeable
 		switch channel.protocol {
 		case "udp":
-			p = NewUdpProxy(tailscale.Tailscale.Server, channel.myPort, channel.target, channel.targetPort)
+			p = NewUdpProxy(ts.Server, channel.myPort, channel.target, channel.targetPort)
 		case "tcp":
-			p = NewTcpProxy(tailscale.Tailscale.Server, channel.myPort, channel.target, channel.targetPort)
+			p = NewTcpProxy(ts.Server, channel.myPort, channel.target, channel.targetPort)
 		default:
-			panic("wat " + channel.protocol)
+			return fmt.Errorf("tsproxy: unknown protocol %q", channel.protocol)
 		}
 
 		proxy.proxies = append(proxy.proxies, p)
 	}
 
 	log.Infof("%d proxies started", len(proxy.proxies))
+	return nil
 }
 
 func (proxy *tsproxy) close() {
@@ -0,0 +1,59 @@
+// Package tsratelimit implements the ratelimit directive, a core server feature
+// (not a plugin in the chain) that throttles queries per client before they ever
+// reach the plugin chain, so it cannot be bypassed by plugin ordering.
+package tsratelimit
+
+import (
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("ratelimit", setup) }
+
+// setup parses: ratelimit <qps> [burst] [ip|tailnet-node|tailnet-user]
+func setup(c *caddy.Controller) error {
+	c.Next() // directive name
+
+	args := c.RemainingArgs()
+	if len(args) < 1 || len(args) > 3 {
+		return c.ArgErr()
+	}
+
+	qps, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return c.Errf("ratelimit: invalid qps %q: %v", args[0], err)
+	}
+
+	burst := int(qps)
+	if len(args) >= 2 {
+		burst, err = strconv.Atoi(args[1])
+		if err != nil {
+			return c.Errf("ratelimit: invalid burst %q: %v", args[1], err)
+		}
+	}
+
+	key := "ip"
+	if len(args) == 3 {
+		key = args[2]
+		switch key {
+		case "ip", "tailnet-node", "tailnet-user":
+		default:
+			return c.Errf("ratelimit: unknown key %q, want ip, tailnet-node or tailnet-user", key)
+		}
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.RateLimitQPS = qps
+	config.RateLimitBurst = burst
+	config.RateLimitKey = key
+
+	c.OnShutdown(func() error {
+		dnsserver.ReleaseRateLimiter(config)
+		return nil
+	})
+
+	return nil
+}
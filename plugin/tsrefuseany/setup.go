@@ -0,0 +1,23 @@
+// Package tsrefuseany implements the refuse-any directive, which declines ANY
+// queries with NOTIMP before they reach the plugin chain.
+package tsrefuseany
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("refuse-any", setup) }
+
+func setup(c *caddy.Controller) error {
+	c.Next() // directive name, no arguments
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.RefuseANY = true
+
+	return nil
+}
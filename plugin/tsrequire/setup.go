@@ -0,0 +1,23 @@
+// Package tsrequire implements the require-tailnet directive, which refuses any
+// query whose source address did not resolve to a Tailscale identity.
+package tsrequire
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("require-tailnet", setup) }
+
+func setup(c *caddy.Controller) error {
+	c.Next() // directive name, no arguments
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.RequireTailnet = true
+
+	return nil
+}
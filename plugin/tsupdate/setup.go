@@ -0,0 +1,71 @@
+// Package tsupdate implements RFC 2136 dynamic updates authenticated by
+// Tailscale identity: a peer may submit a DNS UPDATE if its WhoIs-resolved
+// user, node tag, or ACL capability appears on the plugin's allow-list,
+// without needing a separate TSIG secret.
+package tsupdate
+
+import (
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("tsupdate", setup) }
+
+func setup(c *caddy.Controller) error {
+	u := &TSUpdate{records: make(map[string][]ownedRR), fsync: true}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			u.zoneFile = args[0]
+		default:
+			return c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				kind := c.Val()
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				value := c.Val()
+
+				switch kind {
+				case "user", "tag", "cap":
+				default:
+					return c.Errf("tsupdate: unknown allow kind %q, want user, tag or cap", kind)
+				}
+				u.allowList = append(u.allowList, allowEntry{kind: kind, value: value})
+			case "fsync":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				sync, err := strconv.ParseBool(c.Val())
+				if err != nil {
+					return c.Errf("tsupdate: invalid fsync value %q: %v", c.Val(), err)
+				}
+				u.fsync = sync
+			default:
+				return c.Errf("tsupdate: unknown property %q", c.Val())
+			}
+		}
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.TSUpdateEnabled = true
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		u.Next = next
+		return u
+	})
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package tsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("tsupdate")
+
+type allowEntry struct {
+	kind  string // "user", "tag" or "cap"
+	value string
+}
+
+// ownedRR is a single resource record accepted into the in-memory zone.
+type ownedRR struct {
+	rr dns.RR
+}
+
+// TSUpdate accepts RFC 2136 DNS UPDATE messages from tailnet peers whose WhoIs
+// identity matches allowList, applies them to an in-memory zone, and optionally
+// writes the result through to zoneFile for the file/auto plugins to pick up.
+type TSUpdate struct {
+	Next plugin.Handler
+
+	zoneFile  string
+	fsync     bool
+	allowList []allowEntry
+
+	mu      sync.Mutex
+	records map[string][]ownedRR // owner name (lowercase, fqdn) -> records
+}
+
+// Name implements the plugin.Handler interface.
+func (u *TSUpdate) Name() string { return "tsupdate" }
+
+// ServeDNS implements the plugin.Handler interface. Non-UPDATE queries pass
+// straight through to Next; UPDATE queries are authenticated against the
+// caller's Tailscale identity and applied to the in-memory zone.
+func (u *TSUpdate) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if r.Opcode != dns.OpcodeUpdate {
+		return plugin.NextOrFailure(u.Name(), u.Next, ctx, w, r)
+	}
+
+	peer, _ := ctx.Value(dnsserver.PeerKey{}).(*dnsserver.Peer)
+	if !u.allowed(peer) {
+		return u.reply(w, r, dns.RcodeRefused)
+	}
+
+	zone := zoneName(r)
+
+	if err := u.checkPrerequisites(zone, r); err != nil {
+		if err == errNotZone {
+			return u.reply(w, r, dns.RcodeNotZone)
+		}
+		return u.reply(w, r, dns.RcodeNXRrset)
+	}
+
+	if err := u.applyUpdate(zone, r); err != nil {
+		if err == errNotZone {
+			return u.reply(w, r, dns.RcodeNotZone)
+		}
+		log.Errorf("update for zone %s rejected: %s", zone, err)
+		return u.reply(w, r, dns.RcodeServerFailure)
+	}
+
+	node, user := "", ""
+	if peer != nil {
+		node, user = peer.Node, peer.User
+	}
+	log.Infof("accepted update for zone %s from node=%q user=%q", zone, node, user)
+
+	return u.reply(w, r, dns.RcodeSuccess)
+}
+
+func (u *TSUpdate) reply(w dns.ResponseWriter, r *dns.Msg, rcode int) (int, error) {
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	return rcode, w.WriteMsg(m)
+}
+
+// allowed reports whether peer's tailnet identity appears on the allow-list.
+func (u *TSUpdate) allowed(peer *dnsserver.Peer) bool {
+	if peer == nil {
+		return false
+	}
+	for _, e := range u.allowList {
+		switch e.kind {
+		case "user":
+			if peer.User == e.value {
+				return true
+			}
+		case "tag":
+			if peer.HasTag(e.value) {
+				return true
+			}
+		case "cap":
+			if peer.HasCap(e.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func zoneName(r *dns.Msg) string {
+	if len(r.Question) == 0 {
+		return "."
+	}
+	return r.Question[0].Name
+}
+
+// errNotZone marks a prerequisite or update RR whose owner name falls outside
+// the zone being updated, so ServeDNS can answer with NOTZONE instead of the
+// generic rcodes used for an ordinary prerequisite/update failure.
+var errNotZone = errors.New("name outside zone")
+
+// checkPrerequisites validates the prerequisite section (RFC 2136 section 3.2)
+// against the in-memory zone.
+func (u *TSUpdate) checkPrerequisites(zone string, r *dns.Msg) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, rr := range r.Answer {
+		name := normalizeName(rr.Header().Name)
+		if !dns.IsSubDomain(zone, name) {
+			return errNotZone
+		}
+		switch rr.Header().Class {
+		case dns.ClassANY:
+			if rr.Header().Rrtype == dns.TypeANY {
+				if len(u.records[name]) == 0 {
+					return fmt.Errorf("prerequisite failed: %s not in use", name)
+				}
+				continue
+			}
+			if !u.hasRRset(name, rr.Header().Rrtype) {
+				return fmt.Errorf("prerequisite failed: rrset %s/%d does not exist", name, rr.Header().Rrtype)
+			}
+		case dns.ClassNONE:
+			if rr.Header().Rrtype == dns.TypeANY {
+				if len(u.records[name]) != 0 {
+					return fmt.Errorf("prerequisite failed: %s is in use", name)
+				}
+				continue
+			}
+			if u.hasRRset(name, rr.Header().Rrtype) {
+				return fmt.Errorf("prerequisite failed: rrset %s/%d exists", name, rr.Header().Rrtype)
+			}
+		default:
+			// RRset exists (value dependent): the exact RR, rdata included,
+			// must already be present (RFC 2136 section 3.2.3).
+			if !u.hasRR(name, rr) {
+				return fmt.Errorf("prerequisite failed: %s does not exist", rr.String())
+			}
+		}
+	}
+	return nil
+}
+
+func (u *TSUpdate) hasRRset(name string, rrtype uint16) bool {
+	for _, o := range u.records[name] {
+		if o.rr.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *TSUpdate) hasRR(name string, rr dns.RR) bool {
+	for _, o := range u.records[name] {
+		if rrEqual(o.rr, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyUpdate applies the update section (RFC 2136 section 3.4) to the
+// in-memory zone, then write-through to zoneFile when one is configured.
+func (u *TSUpdate) applyUpdate(zone string, r *dns.Msg) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, rr := range r.Ns {
+		name := normalizeName(rr.Header().Name)
+		if !dns.IsSubDomain(zone, name) {
+			return errNotZone
+		}
+		switch rr.Header().Class {
+		case dns.ClassANY: // delete an RRset (or, for type ANY, all RRsets at name)
+			if rr.Header().Rrtype == dns.TypeANY {
+				delete(u.records, name)
+				continue
+			}
+			u.removeRRset(name, rr.Header().Rrtype)
+		case dns.ClassNONE: // delete a specific RR
+			u.removeRR(name, rr)
+		default: // add the RR
+			u.addRR(name, rr)
+		}
+	}
+
+	if u.zoneFile == "" {
+		return nil
+	}
+	return u.flush()
+}
+
+func (u *TSUpdate) removeRRset(name string, rrtype uint16) {
+	kept := u.records[name][:0]
+	for _, o := range u.records[name] {
+		if o.rr.Header().Rrtype != rrtype {
+			kept = append(kept, o)
+		}
+	}
+	u.records[name] = kept
+}
+
+func (u *TSUpdate) removeRR(name string, match dns.RR) {
+	kept := u.records[name][:0]
+	for _, o := range u.records[name] {
+		if !rrEqual(o.rr, match) {
+			kept = append(kept, o)
+		}
+	}
+	u.records[name] = kept
+}
+
+func (u *TSUpdate) addRR(name string, rr dns.RR) {
+	for i, o := range u.records[name] {
+		if rrEqual(o.rr, rr) {
+			u.records[name][i] = ownedRR{rr: rr}
+			return
+		}
+	}
+	u.records[name] = append(u.records[name], ownedRR{rr: rr})
+}
+
+// rrEqual reports whether a and b are the same resource record - same owner
+// name, type and rdata - ignoring TTL and class. TTL legitimately differs
+// between a freshly-applied update and what's already stored, and the RFC
+// 2136 wire format repurposes class on deletions (NONE) and "value dependent"
+// prerequisites (the zone's own class, but compared here against records
+// that may have a different TTL/class history), so neither belongs in the
+// comparison that decides whether two RRs are "the same record".
+func rrEqual(a, b dns.RR) bool {
+	if a.Header().Rrtype != b.Header().Rrtype {
+		return false
+	}
+	if !strings.EqualFold(dns.Fqdn(a.Header().Name), dns.Fqdn(b.Header().Name)) {
+		return false
+	}
+
+	ac, bc := dns.Copy(a), dns.Copy(b)
+	ac.Header().Ttl, bc.Header().Ttl = 0, 0
+	ac.Header().Class, bc.Header().Class = dns.ClassINET, dns.ClassINET
+	return ac.String() == bc.String()
+}
+
+func normalizeName(name string) string {
+	return dns.Fqdn(name)
+}
+
+// flush writes the in-memory zone out to zoneFile for the file/auto plugins to
+// load, fsyncing it (unless the fsync property is set to false) so a crash
+// right after an accepted UPDATE can't silently lose it.
+func (u *TSUpdate) flush() error {
+	f, err := os.Create(u.zoneFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, rrs := range u.records {
+		for _, o := range rrs {
+			if _, err := fmt.Fprintln(f, o.rr.String()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if u.fsync {
+		return f.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package tsupdate
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("dns.NewRR(%q): %v", s, err)
+	}
+	return rr
+}
+
+func TestRrEqualIgnoresTTLAndClass(t *testing.T) {
+	stored := mustRR(t, "host.example.com. 3600 IN A 1.2.3.4")
+	wireDelete := mustRR(t, "host.example.com. 0 NONE A 1.2.3.4")
+
+	if !rrEqual(stored, wireDelete) {
+		t.Error("rrEqual should match records that differ only in TTL and class")
+	}
+
+	different := mustRR(t, "host.example.com. 3600 IN A 5.6.7.8")
+	if rrEqual(stored, different) {
+		t.Error("rrEqual should not match records with different rdata")
+	}
+}
+
+func newUpdate() *TSUpdate {
+	return &TSUpdate{records: make(map[string][]ownedRR)}
+}
+
+// TestApplyUpdateRemoveRR exercises "Delete An RR From An RRset" (RFC 2136
+// section 3.4.2.4): the wire RR carries CLASS=NONE and TTL=0, which must
+// still match a stored record with its real TTL and IN class.
+func TestApplyUpdateRemoveRR(t *testing.T) {
+	u := newUpdate()
+	u.addRR("host.example.com.", mustRR(t, "host.example.com. 3600 IN A 1.2.3.4"))
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeSOA)
+	msg.Ns = []dns.RR{mustRR(t, "host.example.com. 0 NONE A 1.2.3.4")}
+
+	if err := u.applyUpdate(zoneName(msg), msg); err != nil {
+		t.Fatalf("applyUpdate: %v", err)
+	}
+
+	if got := len(u.records["host.example.com."]); got != 0 {
+		t.Errorf("records after delete = %d, want 0", got)
+	}
+}
+
+// TestApplyUpdateAddRRDedupesAcrossTTLChange ensures re-adding the same
+// name/type/rdata with a bumped TTL updates in place rather than
+// accumulating a duplicate RR in the RRset.
+func TestApplyUpdateAddRRDedupesAcrossTTLChange(t *testing.T) {
+	u := newUpdate()
+	u.addRR("host.example.com.", mustRR(t, "host.example.com. 3600 IN A 1.2.3.4"))
+	u.addRR("host.example.com.", mustRR(t, "host.example.com. 60 IN A 1.2.3.4"))
+
+	if got := len(u.records["host.example.com."]); got != 1 {
+		t.Errorf("records after re-add with new TTL = %d, want 1", got)
+	}
+}
+
+// TestCheckPrerequisitesValueDependent covers the RFC 2136 section 3.2.3
+// "RRset exists (value dependent)" prerequisite, whose wire RR is required
+// to carry TTL=0.
+func TestCheckPrerequisitesValueDependent(t *testing.T) {
+	u := newUpdate()
+	u.addRR("host.example.com.", mustRR(t, "host.example.com. 3600 IN A 1.2.3.4"))
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeSOA)
+	msg.Answer = []dns.RR{mustRR(t, "host.example.com. 0 IN A 1.2.3.4")}
+
+	if err := u.checkPrerequisites(zoneName(msg), msg); err != nil {
+		t.Errorf("checkPrerequisites: %v, want prerequisite to be satisfied", err)
+	}
+
+	msg.Answer = []dns.RR{mustRR(t, "host.example.com. 0 IN A 9.9.9.9")}
+	if err := u.checkPrerequisites(zoneName(msg), msg); err == nil {
+		t.Error("checkPrerequisites: want error for rdata that doesn't match")
+	}
+}
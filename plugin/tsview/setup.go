@@ -0,0 +1,43 @@
+// Package tsview implements the tailnet-view directive, which restricts a
+// server block to callers whose Tailscale identity matches a given user,
+// node tag or ACL capability - the mechanism that lets an operator route
+// different callers to different zone configs/views by tailnet identity.
+package tsview
+
+import (
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("tailnet-view", setup) }
+
+// setup parses one or more "tailnet-view user|tag|cap <value>" lines, each
+// appending a FilterFunc that the Config's view must pass for every query.
+func setup(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		kind, value := args[0], args[1]
+
+		var filter dnsserver.FilterFunc
+		switch kind {
+		case "user":
+			filter = dnsserver.NewUserFilterFunc(value)
+		case "tag":
+			filter = dnsserver.NewTagFilterFunc(value)
+		case "cap":
+			filter = dnsserver.NewCapFilterFunc(value)
+		default:
+			return c.Errf("tailnet-view: unknown kind %q, want user, tag or cap", kind)
+		}
+
+		config.FilterFuncs = append(config.FilterFuncs, filter)
+	}
+
+	return nil
+}